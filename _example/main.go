@@ -66,7 +66,7 @@ func (f *flashDemo) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			if len(msg) == 0 {
 				continue
 			}
-			flash.Push(w, r.Form.Get("category"), msg)
+			flash.Push(w, r, r.Form.Get("category"), msg)
 		}
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 		return
@@ -0,0 +1,29 @@
+package flash
+
+import (
+	"context"
+	"net/http"
+)
+
+type storeContextKey struct{}
+
+// withStore returns a copy of r carrying store in its context. Embed's
+// middleware calls this before invoking the wrapped handler, so that Push,
+// PopAll, Peek, PushWithOptions and PopByCategory called from within that
+// handler resolve the Store configured via WithStore/WithLimits instead of
+// silently falling back to DefaultStore.
+func withStore(r *http.Request, store Store) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), storeContextKey{}, store))
+}
+
+// storeFor returns the Store that should be used for r: the one Embed's
+// middleware injected into its context, or DefaultStore if r was not
+// handled by Embed (or is nil).
+func storeFor(r *http.Request) Store {
+	if r != nil {
+		if store, ok := r.Context().Value(storeContextKey{}).(Store); ok {
+			return store
+		}
+	}
+	return DefaultStore
+}
@@ -0,0 +1,58 @@
+package flash
+
+import (
+	"net/http"
+	"sort"
+	"time"
+)
+
+// mergedCookies returns every cookie matching match, merging cookies
+// attached to r with any pending Set-Cookie headers already queued on w
+// (for instance by an earlier Save or Clear call on this same request). A
+// pending deletion takes precedence over an earlier pending or request
+// value for the same cookie name. The result is sorted by cookie name.
+func mergedCookies(w http.ResponseWriter, r *http.Request, match func(name string) bool) []*http.Cookie {
+	byName := make(map[string]*http.Cookie)
+	if r != nil {
+		for _, c := range r.Cookies() {
+			if match(c.Name) {
+				byName[c.Name] = c
+			}
+		}
+	}
+
+	now := time.Now()
+	for _, c := range (&http.Response{Header: w.Header()}).Cookies() {
+		if !match(c.Name) {
+			continue
+		}
+		if c.MaxAge < 0 || (!c.Expires.IsZero() && c.Expires.Before(now)) {
+			delete(byName, c.Name)
+			continue
+		}
+		byName[c.Name] = c
+	}
+
+	names := make([]string, 0, len(byName))
+	for name := range byName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	cookies := make([]*http.Cookie, 0, len(names))
+	for _, name := range names {
+		cookies = append(cookies, byName[name])
+	}
+	return cookies
+}
+
+// singleCookieValue returns the value of the cookie named name, merging r
+// and w as mergedCookies does. It is a convenience for Stores that keep
+// their state in exactly one cookie (SignedCookieStore, ServerStore).
+func singleCookieValue(w http.ResponseWriter, r *http.Request, name string) (string, bool) {
+	cookies := mergedCookies(w, r, func(n string) bool { return n == name })
+	if len(cookies) == 0 {
+		return "", false
+	}
+	return cookies[0].Value, true
+}
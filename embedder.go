@@ -0,0 +1,240 @@
+package flash
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"html/template"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+type messageMiddleware struct {
+	tmpl  *template.Template
+	store Store
+	next  http.Handler
+}
+
+func (m messageMiddleware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	r = withStore(r, m.store)
+	fe := flashEmbedder{
+		w:     w,
+		r:     r,
+		tmpl:  m.tmpl,
+		store: m.store,
+	}
+	m.next.ServeHTTP(&fe, r)
+	fe.flushRemainder()
+}
+
+// flashEmbedder is a http.ResponseWriter decorator that injects flash
+// messages into an HTML response as it is written.
+//
+// The response body is fed into an html.Tokenizer through an internal
+// buffer. Only bytes that have been parsed into complete tokens are ever
+// written to the underlying ResponseWriter; whatever trailing bytes could
+// still turn out to be the start of a <flashmessages> or </body> tag are
+// held back in buf until either more data arrives or the response ends.
+type flashEmbedder struct {
+	embed *bool
+	w     http.ResponseWriter
+	r     *http.Request
+	msgs  []*Message
+	tmpl  *template.Template
+	store Store
+
+	buf      []byte
+	injected bool
+}
+
+// sniffLen mirrors the prefix length net/http.DetectContentType looks at,
+// so that the content type decision is made against a buffered prefix large
+// enough to be reliable, rather than against whatever (possibly tiny) slice
+// happens to be passed to the first Write call.
+const sniffLen = 512
+
+func (f *flashEmbedder) Header() http.Header {
+	return f.w.Header()
+}
+
+func (f *flashEmbedder) Write(data []byte) (int, error) {
+	if f.embed != nil && !*f.embed {
+		return f.w.Write(data)
+	}
+
+	f.buf = append(f.buf, data...)
+
+	if f.embed == nil {
+		ct := f.w.Header().Get("content-type")
+		switch {
+		case ct != "":
+			f.setEmbed(strings.HasPrefix(ct, "text/html"))
+		case len(f.buf) < sniffLen:
+			// Not enough of a prefix yet to sniff reliably; hold
+			// everything back until more data arrives or the
+			// response ends.
+			return len(data), nil
+		default:
+			f.setEmbed(strings.HasPrefix(http.DetectContentType(f.buf), "text/html"))
+		}
+
+		if !*f.embed {
+			buffered := f.buf
+			f.buf = nil
+			_, err := f.w.Write(buffered)
+			return len(data), err
+		}
+	}
+
+	if err := f.tokenize(false); err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
+
+// setEmbed records the content type decision and, if it is HTML, loads the
+// flash messages to inject.
+func (f *flashEmbedder) setEmbed(isHTML bool) {
+	f.embed = &isHTML
+	if isHTML {
+		f.msgs, _ = f.store.Load(f.w, f.r)
+		_ = f.store.Clear(f.w, f.r)
+	}
+}
+
+func (f *flashEmbedder) WriteHeader(statusCode int) {
+	f.w.WriteHeader(statusCode)
+}
+
+// Flush passes through to the underlying ResponseWriter, if it supports
+// http.Flusher. Bytes that Write is still holding back in buf (a prefix
+// shorter than sniffLen awaiting the content type decision, or trailing
+// bytes that may start a tag) are not flushed; they are written once more
+// data arrives or the wrapped handler returns.
+func (f *flashEmbedder) Flush() {
+	if fl, ok := f.w.(http.Flusher); ok {
+		fl.Flush()
+	}
+}
+
+// Hijack passes through to the underlying ResponseWriter, if it supports
+// http.Hijacker.
+func (f *flashEmbedder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := f.w.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("flash: underlying ResponseWriter does not support hijacking")
+	}
+	return hj.Hijack()
+}
+
+// flushRemainder is called once the wrapped handler is done writing, to
+// flush whatever bytes are still held back in buf. At this point no more
+// data is coming, so those bytes can no longer turn into a recognised tag
+// and are written out verbatim.
+//
+// If the whole response body was smaller than sniffLen, the content type
+// decision in Write is never forced; make it here instead, against
+// whatever was buffered.
+func (f *flashEmbedder) flushRemainder() {
+	if f.embed == nil {
+		if len(f.buf) == 0 {
+			return
+		}
+		ct := f.w.Header().Get("content-type")
+		if ct != "" {
+			f.setEmbed(strings.HasPrefix(ct, "text/html"))
+		} else {
+			f.setEmbed(strings.HasPrefix(http.DetectContentType(f.buf), "text/html"))
+		}
+		if !*f.embed {
+			buffered := f.buf
+			f.buf = nil
+			_, _ = f.w.Write(buffered)
+			return
+		}
+	}
+
+	if !*f.embed {
+		return
+	}
+	_ = f.tokenize(true)
+}
+
+// tokenize parses as much of buf as forms complete tokens, replacing a
+// <flashmessages> tag (or, failing that, the first </body> tag) with the
+// rendered flash messages. Bytes that cannot yet be told apart from the
+// start of such a tag are kept in buf for the next call. If final is true,
+// buf is flushed in full, since no further data will arrive to disambiguate it.
+func (f *flashEmbedder) tokenize(final bool) error {
+	z := html.NewTokenizer(bytes.NewReader(f.buf))
+
+	var out bytes.Buffer
+	consumed := 0
+	for {
+		// ErrorToken is returned at the end of buf, including when a
+		// tag is cut short by it; such a tag is not counted in consumed.
+		if z.Next() == html.ErrorToken {
+			break
+		}
+
+		// Token rewrites the tokenizer's buffer in place (lower-cased
+		// names, unescaped entities), so copy the raw bytes first.
+		raw := append([]byte(nil), z.Raw()...)
+		tok := z.Token()
+		if !final && tok.Type == html.TextToken && consumed+len(raw) == len(f.buf) {
+			// Trailing text may end with the start of a tag whose
+			// rest is yet to be written; hold back from its last '<'.
+			if i := bytes.LastIndexByte(raw, '<'); i >= 0 {
+				raw = raw[:i]
+			}
+			out.Write(raw)
+			consumed += len(raw)
+			break
+		}
+		consumed += len(raw)
+		switch tok.Type {
+		case html.StartTagToken, html.SelfClosingTagToken:
+			if tok.Data == "flashmessages" {
+				if !f.injected {
+					out.Write(f.renderFlash())
+					f.injected = true
+				}
+				continue
+			}
+		case html.EndTagToken:
+			if tok.Data == "body" && !f.injected && len(f.msgs) > 0 {
+				out.Write(f.renderFlash())
+				f.injected = true
+			}
+		}
+		out.Write(raw)
+	}
+
+	if final {
+		out.Write(f.buf[consumed:])
+		f.buf = nil
+	} else {
+		f.buf = append([]byte(nil), f.buf[consumed:]...)
+	}
+
+	if out.Len() == 0 {
+		return nil
+	}
+	_, err := f.w.Write(out.Bytes())
+	return err
+}
+
+func (f *flashEmbedder) renderFlash() []byte {
+	ctx := RenderContext{
+		Request:  f.r,
+		Now:      time.Now(),
+		Messages: f.msgs,
+	}
+	var b bytes.Buffer
+	_ = f.tmpl.Execute(&b, ctx)
+	return b.Bytes()
+}
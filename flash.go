@@ -1,67 +1,105 @@
 package flash
 
 import (
-	"bytes"
-	"encoding/base64"
-	"encoding/json"
-	"fmt"
+	"crypto/rand"
+	"encoding/hex"
 	"html/template"
 	"net/http"
-	"sort"
-	"strings"
 	"time"
 )
 
 type Message struct {
-	Category string `json:"c"`
-	Text     string `json:"t"`
+	ID        string    `json:"id"`
+	Category  string    `json:"c"`
+	Text      string    `json:"t"`
+	CreatedAt time.Time `json:"ts"`
 }
 
-// Push writes a single flash message. This function must be called before the
-// HTTP response header is written.
-func Push(w http.ResponseWriter, category, text string) {
-	raw, _ := json.Marshal(Message{Category: category, Text: text})
-	now := time.Now()
-	http.SetCookie(w, &http.Cookie{
-		Name:     fmt.Sprintf("flash_%d", now.UnixNano()),
-		Value:    base64.StdEncoding.EncodeToString(raw),
-		HttpOnly: true,
-		Expires:  time.Now().Add(time.Hour),
-	})
+// HTML returns Text as trusted, unescaped HTML. Use it only for messages
+// whose content the application itself controls; text coming from user
+// input must be left as Text so the template's default auto-escaping
+// applies.
+func (m *Message) HTML() template.HTML {
+	return template.HTML(m.Text)
 }
 
-// PopAll returns all flash messages and deletes them from the cookie. This
-// function must be called before the HTTP response header is written.
-func PopAll(w http.ResponseWriter, r *http.Request) []*Message {
-	var flashes []*http.Cookie
-	for _, c := range r.Cookies() {
-		if strings.HasPrefix(c.Name, "flash_") {
-			flashes = append(flashes, c)
-		}
-	}
-
-	sort.Slice(flashes, func(i, j int) bool {
-		return flashes[i].Name < flashes[j].Name
-	})
-
-	msgs := make([]*Message, 0, len(flashes))
-	for _, c := range flashes {
-		http.SetCookie(w, &http.Cookie{
-			Name:     c.Name,
-			MaxAge:   -1,
-			Expires:  time.Unix(1, 0),
-			HttpOnly: c.HttpOnly,
-		})
-		raw, err := base64.StdEncoding.DecodeString(c.Value)
-		if err != nil {
-			continue
+// ensureMeta assigns an ID and CreatedAt to any message missing them, so
+// that messages Saved directly through a Store (and not just through Push)
+// still carry the metadata templates rely on.
+func ensureMeta(msgs []*Message) {
+	now := time.Now()
+	for _, m := range msgs {
+		if m.ID == "" {
+			m.ID = randomHex(8)
 		}
-		var m Message
-		if err := json.Unmarshal(raw, &m); err != nil {
-			continue
+		if m.CreatedAt.IsZero() {
+			m.CreatedAt = now
 		}
-		msgs = append(msgs, &m)
 	}
+}
+
+func randomHex(n int) string {
+	raw := make([]byte, n)
+	_, _ = rand.Read(raw)
+	return hex.EncodeToString(raw)
+}
+
+// Store is a pluggable flash messages storage backend. It is responsible
+// for persisting messages pushed on one response so that a later call (be
+// it on a subsequent request, or the same request as described on Load) can
+// retrieve and then clear them.
+type Store interface {
+	// Save persists msgs. Save must be called before the HTTP response
+	// header is written.
+	Save(w http.ResponseWriter, r *http.Request, msgs []*Message) error
+
+	// Load returns all messages currently stored. Implementations should
+	// also return messages that were Saved earlier during the handling
+	// of this same request, even though they might not have made a
+	// round trip to the browser yet.
+	Load(w http.ResponseWriter, r *http.Request) ([]*Message, error)
+
+	// Clear removes all stored messages. Clear must be called before
+	// the HTTP response header is written.
+	Clear(w http.ResponseWriter, r *http.Request) error
+}
+
+// DefaultStore is the Store used by Push, PopAll and Peek.
+var DefaultStore Store = NewCookieStore()
+
+// Push writes a single flash message to the Store configured on r (via
+// Embed's WithStore/WithLimits), or to DefaultStore if r was not handled by
+// Embed. This function must be called before the HTTP response header is
+// written.
+//
+// r should be the request being handled, so that Stores which accumulate
+// messages into a single cookie or session (SignedCookieStore, ServerStore)
+// can find and extend it instead of starting a new one.
+func Push(w http.ResponseWriter, r *http.Request, category, text string) {
+	_ = storeFor(r).Save(w, r, []*Message{{Category: category, Text: text}})
+}
+
+// PopAll returns all flash messages from the Store configured on r (see
+// Push) and deletes them. This function must be called before the HTTP
+// response header is written.
+//
+// Messages that were Pushed earlier during the handling of this very
+// request are also returned, even though they might only exist as pending
+// Set-Cookie headers on w and have not made a round trip to the browser
+// yet. This lets a handler Push a message and then render a page directly,
+// without requiring a redirect.
+func PopAll(w http.ResponseWriter, r *http.Request) []*Message {
+	store := storeFor(r)
+	msgs, _ := store.Load(w, r)
+	_ = store.Clear(w, r)
+	return msgs
+}
+
+// Peek returns all flash messages from the Store configured on r (see Push)
+// without deleting them. Unlike PopAll, a subsequent call (Peek or PopAll)
+// will still see the same messages.
+func Peek(w http.ResponseWriter, r *http.Request) []*Message {
+	msgs, _ := storeFor(r).Load(w, r)
 	return msgs
 }
 
@@ -71,113 +109,84 @@ func PopAll(w http.ResponseWriter, r *http.Request) []*Message {
 // A template can be provided to render flash Message using a custom template.
 // If nil template is given, a default template is used.
 //
+// By default flash messages are loaded from and cleared through
+// DefaultStore. Use WithStore to configure a different backend, for example
+// to switch to a SignedCookieStore or a ServerStore. The configured Store is
+// also made available to Push, PopAll, Peek, PushWithOptions and
+// PopByCategory called from within the wrapped handler, so the top-level
+// API keeps working unchanged regardless of which Store was configured.
+//
 // If the request response body contains <flashmessages> tag, that tag is
 // replaced with flash messages (or removed). If <flashmessages> tag is not
 // present, flash messages are inserted before </body>.
 //
-// Search algorithm scans data passed in the ResponseWriter Write calls. For
-// this reason, the response body is expected to make Write calls with payload
-// containing complete tags, for example []byte("<div>foo") and not
-// []byte("<di") or []byte("</s")))
-func Embed(tmpl *template.Template) func(http.Handler) http.Handler {
+// The response body is tokenized incrementally as it is written, so a
+// handler is free to split tags across arbitrary Write calls, for example
+// []byte("<di") followed by []byte("v>").
+//
+// The template is executed with a RenderContext, not a bare slice of
+// messages. A custom template built with template.New(...).Funcs(...) can
+// add flash.TemplateFuncs to gain access to byCategory, hasCategory,
+// jsEscape and markdown.
+func Embed(tmpl *template.Template, opts ...Option) func(http.Handler) http.Handler {
 	if tmpl == nil {
 		tmpl = defaultTmpl
 	}
+	o := embedOptions{store: DefaultStore}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.limits != (Config{}) {
+		o.store = NewCappedStore(o.store, o.limits)
+	}
 	return func(next http.Handler) http.Handler {
 		return &messageMiddleware{
-			tmpl: tmpl,
-			next: next,
+			tmpl:  tmpl,
+			store: o.store,
+			next:  next,
 		}
 	}
 }
 
-var defaultTmpl = template.Must(template.New("").Parse(`
-<div class="flash-messages">
-	{{- range . -}}
-		<div class="alert alert-{{.Category}}">{{.Text}}</div>
-	{{- end -}}
-</div>
-`))
+// Option configures the behaviour of Embed.
+type Option func(*embedOptions)
 
-type messageMiddleware struct {
-	tmpl *template.Template
-	next http.Handler
+type embedOptions struct {
+	store  Store
+	limits Config
 }
 
-func (m messageMiddleware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	fe := flashEmbedder{
-		w:    w,
-		r:    r,
-		tmpl: m.tmpl,
+// WithStore configures the Store used to load and clear flash messages. If
+// not given, DefaultStore is used.
+func WithStore(store Store) Option {
+	return func(o *embedOptions) {
+		o.store = store
 	}
-	m.next.ServeHTTP(&fe, r)
-}
-
-type flashEmbedder struct {
-	embed *bool
-	w     http.ResponseWriter
-	r     *http.Request
-	msgs  []*Message
-	tmpl  *template.Template
-}
-
-func (f *flashEmbedder) Header() http.Header {
-	return f.w.Header()
 }
 
-func (f *flashEmbedder) Write(data []byte) (int, error) {
-	if f.embed == nil {
-		ct := f.w.Header().Get("content-type")
-		if ct == "" {
-			ct = http.DetectContentType(data)
-		}
-		isHTML := strings.HasPrefix(ct, "text/html")
-		f.embed = &isHTML
-		if isHTML {
-			f.msgs = PopAll(f.w, f.r)
-		}
-	}
-
-	if !*f.embed {
-		return f.w.Write(data)
+// WithLimits wraps the configured Store in a CappedStore, enforcing cfg on
+// every message Saved through this middleware, including by Push and
+// PushWithOptions called from within the wrapped handler.
+func WithLimits(cfg Config) Option {
+	return func(o *embedOptions) {
+		o.limits = cfg
 	}
-
-	start := bytes.Index(data, []byte(`<flashmessages>`))
-	end := start + len("<flashmessages>")
-	if start < 0 && len(f.msgs) > 0 {
-		start = bytes.Index(data, []byte(`</body>`))
-		end = start
-	}
-
-	if start < 0 {
-		return f.w.Write(data)
-	}
-
-	total, err := f.w.Write(data[:start])
-	if err != nil {
-		return total, err
-	}
-
-	if len(f.msgs) > 0 {
-		n, err := f.w.Write(f.renderFlash())
-		total += n
-		if err != nil {
-			return total, err
-		}
-		f.msgs = nil
-	}
-
-	n, err := f.w.Write(data[end:])
-	total += n
-	return total, err
 }
 
-func (f *flashEmbedder) WriteHeader(statusCode int) {
-	f.w.WriteHeader(statusCode)
+// RenderContext is the data the template given to Embed is executed with.
+type RenderContext struct {
+	// Request is the request being served.
+	Request *http.Request
+	// Now is the time the flash messages are being rendered.
+	Now time.Time
+	// Messages are the flash messages to render.
+	Messages []*Message
 }
 
-func (f *flashEmbedder) renderFlash() []byte {
-	var b bytes.Buffer
-	_ = f.tmpl.Execute(&b, f.msgs)
-	return b.Bytes()
-}
+var defaultTmpl = template.Must(template.New("").Funcs(TemplateFuncs).Parse(`
+<div class="flash-messages">
+	{{- range .Messages -}}
+		<div class="alert alert-{{.Category}}">{{.Text}}</div>
+	{{- end -}}
+</div>
+`))
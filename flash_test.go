@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"html/template"
 	"io"
+	"math/rand"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -74,13 +75,12 @@ func TestMiddleware(t *testing.T) {
 				// random chunk sizes, to ensure that the parse
 				// does not rely on a complete document being
 				// sent.
-				//body := tc.Body
-				//for len(body) > 0 {
-				//	n := rand.Intn(len(body) + 1)
-				//	_, _ = io.WriteString(w, body[:n])
-				//	body = body[n:]
-				//}
-				io.WriteString(w, tc.Body)
+				body := tc.Body
+				for len(body) > 0 {
+					n := rand.Intn(len(body) + 1)
+					_, _ = io.WriteString(w, body[:n])
+					body = body[n:]
+				}
 			})
 
 			w := httptest.NewRecorder()
@@ -98,7 +98,7 @@ func TestMiddleware(t *testing.T) {
 			}
 
 			tmpl := template.Must(template.New("").Parse(`
-			{{- range . -}}
+			{{- range .Messages -}}
 				[{{.Category}}:{{.Text}}]
 			{{- end -}}
 			`))
@@ -115,6 +115,40 @@ func TestMiddleware(t *testing.T) {
 
 func flash(category, text string) string {
 	w := httptest.NewRecorder()
-	Push(w, category, text)
+	r := httptest.NewRequest("GET", "/", nil)
+	Push(w, r, category, text)
 	return w.Header()["Set-Cookie"][0]
 }
+
+func TestPopAllReadsBackMessagesPushedOnTheSameResponse(t *testing.T) {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+
+	Push(w, r, "a-category", "a-text")
+
+	msgs := PopAll(w, r)
+	if len(msgs) != 1 {
+		t.Fatalf("want one message, got %d", len(msgs))
+	}
+	if msgs[0].Category != "a-category" || msgs[0].Text != "a-text" {
+		t.Fatalf("unexpected message: %+v", msgs[0])
+	}
+
+	if msgs := PopAll(w, r); len(msgs) != 0 {
+		t.Fatalf("messages must be popped only once, got %d", len(msgs))
+	}
+}
+
+func TestPeekDoesNotDeleteMessages(t *testing.T) {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+
+	Push(w, r, "a-category", "a-text")
+
+	for i := 0; i < 2; i++ {
+		msgs := Peek(w, r)
+		if len(msgs) != 1 {
+			t.Fatalf("want one message, got %d", len(msgs))
+		}
+	}
+}
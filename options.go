@@ -0,0 +1,68 @@
+package flash
+
+import (
+	"net/http"
+	"time"
+)
+
+// Options customizes the cookie attributes used when a message is stored
+// in a cookie.
+type Options struct {
+	// MaxAge is how long the cookie should live. Zero means the package
+	// default of one hour.
+	MaxAge time.Duration
+	// Path restricts the cookie to URLs below it. Zero means "/".
+	Path string
+	// Domain restricts the cookie to the given host. Zero means a
+	// host-only cookie.
+	Domain string
+	// Secure marks the cookie as HTTPS-only.
+	Secure bool
+	// SameSite controls cross-site sending of the cookie. Zero means
+	// http.SameSiteLaxMode.
+	SameSite http.SameSite
+}
+
+func (o Options) orDefaults() Options {
+	if o.SameSite == http.SameSiteDefaultMode {
+		o.SameSite = http.SameSiteLaxMode
+	}
+	if o.Path == "" {
+		o.Path = "/"
+	}
+	if o.MaxAge == 0 {
+		o.MaxAge = time.Hour
+	}
+	return o
+}
+
+// OptionsStore is implemented by Stores that support per-message cookie
+// attributes, such as CookieStore. PushWithOptions uses it when the
+// configured Store supports it, and falls back to a plain Save otherwise.
+type OptionsStore interface {
+	Store
+	SaveWithOptions(w http.ResponseWriter, r *http.Request, msgs []*Message, opts Options) error
+}
+
+// PushWithOptions writes a single flash message to the Store configured on
+// r (see Push), applying opts if that Store implements OptionsStore (as
+// CookieStore does). This function must be called before the HTTP response
+// header is written.
+//
+// r should be the request being handled; see Push.
+func PushWithOptions(w http.ResponseWriter, r *http.Request, msg Message, opts Options) {
+	store := storeFor(r)
+	if os, ok := store.(OptionsStore); ok {
+		_ = os.SaveWithOptions(w, r, []*Message{&msg}, opts)
+		return
+	}
+	_ = store.Save(w, r, []*Message{&msg})
+}
+
+// PopByCategory pops (and discards) every flash message from the Store
+// configured on r (see Push), like PopAll, but returns only those of the
+// given category. This function must be called before the HTTP response
+// header is written.
+func PopByCategory(w http.ResponseWriter, r *http.Request, category string) []*Message {
+	return byCategory(PopAll(w, r), category)
+}
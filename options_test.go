@@ -0,0 +1,73 @@
+package flash
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestPushWithOptionsSetsCookieAttributes(t *testing.T) {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+	PushWithOptions(w, r, Message{Category: "a-category", Text: "a-text"}, Options{
+		MaxAge:   time.Minute,
+		Path:     "/admin",
+		Domain:   "example.com",
+		Secure:   true,
+		SameSite: http.SameSiteStrictMode,
+	})
+
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("want one cookie, got %d", len(cookies))
+	}
+	c := cookies[0]
+	if !c.Secure || c.SameSite != http.SameSiteStrictMode || c.Path != "/admin" || c.Domain != "example.com" {
+		t.Fatalf("unexpected cookie attributes: %+v", c)
+	}
+}
+
+func TestPushWithOptionsDeletionCookieMatchesCustomPath(t *testing.T) {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+
+	PushWithOptions(w, r, Message{Category: "a-category", Text: "a-text"}, Options{Path: "/admin"})
+
+	msgs := PopAll(w, r)
+	if len(msgs) != 1 {
+		t.Fatalf("want one message, got %d", len(msgs))
+	}
+
+	cookies := w.Result().Cookies()
+	var deletion *http.Cookie
+	for _, c := range cookies {
+		if c.MaxAge < 0 {
+			deletion = c
+		}
+	}
+	if deletion == nil {
+		t.Fatalf("want a deletion cookie, got %+v", cookies)
+	}
+	if deletion.Path != "/admin" {
+		t.Fatalf("deletion cookie must match the Path the message was pushed with, want /admin, got %q", deletion.Path)
+	}
+}
+
+func TestPopByCategory(t *testing.T) {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+
+	Push(w, r, "info", "a")
+	Push(w, r, "error", "b")
+	Push(w, r, "info", "c")
+
+	msgs := PopByCategory(w, r, "info")
+	if len(msgs) != 2 || msgs[0].Text != "a" || msgs[1].Text != "c" {
+		t.Fatalf("unexpected messages: %+v", msgs)
+	}
+
+	if msgs := PopAll(w, r); len(msgs) != 0 {
+		t.Fatalf("PopByCategory must clear every message, not just the matching ones, got %d", len(msgs))
+	}
+}
@@ -0,0 +1,120 @@
+package flash
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// CookieStore is the default Store. It keeps one cookie per message, named
+// flash_<nanosecond timestamp>, so that message order can be recovered by
+// sorting cookie names.
+type CookieStore struct {
+	// Options configures the attributes applied to every flash_* cookie
+	// this store sets. A zero Options applies the package defaults:
+	// SameSite=Lax, Path="/", a one hour MaxAge and no Domain.
+	Options Options
+}
+
+// NewCookieStore returns a CookieStore.
+func NewCookieStore() *CookieStore {
+	return &CookieStore{}
+}
+
+func (s *CookieStore) Save(w http.ResponseWriter, r *http.Request, msgs []*Message) error {
+	return s.save(w, msgs, s.Options)
+}
+
+// SaveWithOptions is like Save, but applies opts instead of s.Options to
+// the cookies set for msgs.
+func (s *CookieStore) SaveWithOptions(w http.ResponseWriter, r *http.Request, msgs []*Message, opts Options) error {
+	return s.save(w, msgs, opts)
+}
+
+func (s *CookieStore) save(w http.ResponseWriter, msgs []*Message, opts Options) error {
+	ensureMeta(msgs)
+	opts = opts.orDefaults()
+	now := time.Now()
+	for i, m := range msgs {
+		raw, err := json.Marshal(m)
+		if err != nil {
+			return fmt.Errorf("cannot marshal message: %w", err)
+		}
+		http.SetCookie(w, &http.Cookie{
+			Name:     fmt.Sprintf("flash_%d", now.UnixNano()+int64(i)),
+			Value:    base64.StdEncoding.EncodeToString(raw),
+			HttpOnly: true,
+			Secure:   opts.Secure,
+			SameSite: opts.SameSite,
+			Path:     opts.Path,
+			Domain:   opts.Domain,
+			Expires:  now.Add(opts.MaxAge),
+		})
+	}
+	return nil
+}
+
+func (s *CookieStore) Load(w http.ResponseWriter, r *http.Request) ([]*Message, error) {
+	flashes := collectFlashCookies(w, r)
+	msgs := make([]*Message, 0, len(flashes))
+	for _, c := range flashes {
+		if m := decodeMessage(c.Value); m != nil {
+			msgs = append(msgs, m)
+		}
+	}
+	return msgs, nil
+}
+
+func (s *CookieStore) Clear(w http.ResponseWriter, r *http.Request) error {
+	opts := s.Options.orDefaults()
+	for _, c := range collectFlashCookies(w, r) {
+		// A browser never sends Path/Domain back on the Cookie
+		// header, so c.Path/c.Domain are only populated when c is
+		// still pending as a Set-Cookie header on this same
+		// response (as set by Save, possibly through
+		// SaveWithOptions with a non-default Path/Domain). Prefer
+		// that exact value; a cookie coming only from a previous
+		// request can at best be matched against the store's
+		// current defaults.
+		path, domain := c.Path, c.Domain
+		if path == "" {
+			path = opts.Path
+		}
+		if domain == "" {
+			domain = opts.Domain
+		}
+		http.SetCookie(w, &http.Cookie{
+			Name:     c.Name,
+			MaxAge:   -1,
+			Expires:  time.Unix(1, 0),
+			HttpOnly: c.HttpOnly,
+			Path:     path,
+			Domain:   domain,
+		})
+	}
+	return nil
+}
+
+// collectFlashCookies returns the deduplicated set of flash_* cookies,
+// merged from r and w by mergedCookies. The result is sorted by cookie
+// name, which is also the order in which the messages were pushed.
+func collectFlashCookies(w http.ResponseWriter, r *http.Request) []*http.Cookie {
+	return mergedCookies(w, r, func(name string) bool {
+		return strings.HasPrefix(name, "flash_")
+	})
+}
+
+func decodeMessage(value string) *Message {
+	raw, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return nil
+	}
+	var m Message
+	if err := json.Unmarshal(raw, &m); err != nil {
+		return nil
+	}
+	return &m
+}
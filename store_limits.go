@@ -0,0 +1,142 @@
+package flash
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// OverflowPolicy decides what happens once a CappedStore has more messages,
+// or more bytes of messages, than its Config allows.
+type OverflowPolicy int
+
+const (
+	// DropOldest discards the oldest messages until the store is back
+	// within its configured limits. It is the zero value.
+	DropOldest OverflowPolicy = iota
+	// DropNewest discards the most recently pushed messages instead.
+	DropNewest
+	// ErrorOnOverflow makes Save fail instead of storing anything once a
+	// limit would be exceeded.
+	ErrorOnOverflow
+)
+
+// Config bounds how many flash messages, and how many serialized bytes of
+// them, a CappedStore may hold pending until they are cleared. Left unbounded, a
+// handler that Pushes in a loop (or an attacker triggering many Pushes) can
+// grow past the ~4KB per-cookie and ~80 cookies-per-domain browser limits.
+type Config struct {
+	// MaxMessages caps how many messages may be pending at once. Zero
+	// means no limit.
+	MaxMessages int
+	// MaxTotalBytes caps the total JSON-encoded size of pending
+	// messages. Zero means no limit.
+	MaxTotalBytes int
+	// OnOverflow decides what happens once a limit is hit. The zero
+	// value is DropOldest.
+	OnOverflow OverflowPolicy
+}
+
+// CappedStore wraps another Store and enforces Config on top of it, by
+// loading whatever is already pending, appending the newly pushed messages,
+// trimming the result down to Config's limits, and rewriting the store.
+type CappedStore struct {
+	Store
+	Config Config
+}
+
+// NewCappedStore returns a Store that enforces cfg on top of inner.
+func NewCappedStore(inner Store, cfg Config) *CappedStore {
+	return &CappedStore{Store: inner, Config: cfg}
+}
+
+func (s *CappedStore) Save(w http.ResponseWriter, r *http.Request, msgs []*Message) error {
+	return s.save(w, r, msgs, nil)
+}
+
+// SaveWithOptions is like Save, but forwards opts to the wrapped Store if it
+// implements OptionsStore (as CookieStore does), so that WithLimits and
+// PushWithOptions can be combined.
+func (s *CappedStore) SaveWithOptions(w http.ResponseWriter, r *http.Request, msgs []*Message, opts Options) error {
+	return s.save(w, r, msgs, &opts)
+}
+
+func (s *CappedStore) save(w http.ResponseWriter, r *http.Request, msgs []*Message, opts *Options) error {
+	existing, err := s.Store.Load(w, r)
+	if err != nil {
+		return err
+	}
+
+	capped, err := s.Config.apply(append(existing, msgs...))
+	if err != nil {
+		return err
+	}
+
+	if err := s.Store.Clear(w, r); err != nil {
+		return err
+	}
+	if len(capped) == 0 {
+		return nil
+	}
+	if opts != nil {
+		if os, ok := s.Store.(OptionsStore); ok {
+			return os.SaveWithOptions(w, r, capped, *opts)
+		}
+	}
+	return s.Store.Save(w, r, capped)
+}
+
+func (c Config) apply(msgs []*Message) ([]*Message, error) {
+	out := msgs
+
+	if c.MaxMessages > 0 && len(out) > c.MaxMessages {
+		switch c.OnOverflow {
+		case ErrorOnOverflow:
+			return nil, fmt.Errorf("flash: %d messages exceed the configured limit of %d", len(out), c.MaxMessages)
+		case DropNewest:
+			out = out[:c.MaxMessages]
+		default: // DropOldest
+			out = out[len(out)-c.MaxMessages:]
+		}
+	}
+
+	if c.MaxTotalBytes > 0 {
+		var err error
+		out, err = c.trimBytes(out)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return out, nil
+}
+
+func (c Config) trimBytes(msgs []*Message) ([]*Message, error) {
+	size := totalSize(msgs)
+	if size <= c.MaxTotalBytes {
+		return msgs, nil
+	}
+
+	switch c.OnOverflow {
+	case ErrorOnOverflow:
+		return nil, fmt.Errorf("flash: %d bytes of messages exceed the configured limit of %d", size, c.MaxTotalBytes)
+	case DropNewest:
+		for len(msgs) > 0 && totalSize(msgs) > c.MaxTotalBytes {
+			msgs = msgs[:len(msgs)-1]
+		}
+	default: // DropOldest
+		for len(msgs) > 0 && totalSize(msgs) > c.MaxTotalBytes {
+			msgs = msgs[1:]
+		}
+	}
+	return msgs, nil
+}
+
+func totalSize(msgs []*Message) int {
+	n := 0
+	for _, m := range msgs {
+		raw, _ := json.Marshal(m)
+		n += len(raw)
+	}
+	return n
+}
@@ -0,0 +1,98 @@
+package flash
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCappedStoreDropOldest(t *testing.T) {
+	store := NewCappedStore(NewCookieStore(), Config{MaxMessages: 2})
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+
+	for _, text := range []string{"a", "b", "c"} {
+		if err := store.Save(w, r, []*Message{{Category: "x", Text: text}}); err != nil {
+			t.Fatalf("save: %s", err)
+		}
+	}
+
+	msgs, err := store.Load(w, r)
+	if err != nil {
+		t.Fatalf("load: %s", err)
+	}
+	if len(msgs) != 2 || msgs[0].Text != "b" || msgs[1].Text != "c" {
+		t.Fatalf("want [b c], got %+v", msgs)
+	}
+}
+
+func TestCappedStoreDropNewest(t *testing.T) {
+	store := NewCappedStore(NewCookieStore(), Config{MaxMessages: 2, OnOverflow: DropNewest})
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+
+	for _, text := range []string{"a", "b", "c"} {
+		if err := store.Save(w, r, []*Message{{Category: "x", Text: text}}); err != nil {
+			t.Fatalf("save: %s", err)
+		}
+	}
+
+	msgs, err := store.Load(w, r)
+	if err != nil {
+		t.Fatalf("load: %s", err)
+	}
+	if len(msgs) != 2 || msgs[0].Text != "a" || msgs[1].Text != "b" {
+		t.Fatalf("want [a b], got %+v", msgs)
+	}
+}
+
+func TestCappedStoreErrorOnOverflow(t *testing.T) {
+	store := NewCappedStore(NewCookieStore(), Config{MaxMessages: 1, OnOverflow: ErrorOnOverflow})
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+
+	if err := store.Save(w, r, []*Message{{Category: "x", Text: "a"}}); err != nil {
+		t.Fatalf("save: %s", err)
+	}
+	if err := store.Save(w, r, []*Message{{Category: "x", Text: "b"}}); err == nil {
+		t.Fatalf("want an error once the message limit is exceeded")
+	}
+}
+
+func TestCappedStoreForwardsOptions(t *testing.T) {
+	orig := DefaultStore
+	defer func() { DefaultStore = orig }()
+	DefaultStore = NewCappedStore(NewCookieStore(), Config{MaxMessages: 5})
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+	PushWithOptions(w, r, Message{Category: "a-category", Text: "a-text"}, Options{
+		Path:   "/admin",
+		Secure: true,
+	})
+
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("want one cookie, got %d", len(cookies))
+	}
+	if c := cookies[0]; !c.Secure || c.Path != "/admin" {
+		t.Fatalf("CappedStore dropped the Options given to PushWithOptions: %+v", c)
+	}
+}
+
+func TestCappedStoreMaxTotalBytes(t *testing.T) {
+	store := NewCappedStore(NewCookieStore(), Config{MaxTotalBytes: 1})
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+
+	if err := store.Save(w, r, []*Message{{Category: "x", Text: "a long enough message"}}); err != nil {
+		t.Fatalf("save: %s", err)
+	}
+
+	msgs, err := store.Load(w, r)
+	if err != nil {
+		t.Fatalf("load: %s", err)
+	}
+	if len(msgs) != 0 {
+		t.Fatalf("want the oversized message to be dropped, got %+v", msgs)
+	}
+}
@@ -0,0 +1,144 @@
+package flash
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ServerBackend persists flash messages for a session, keyed by an opaque
+// session id. MemoryBackend is the default, in-process implementation;
+// applications that need sessions to survive across instances or restarts
+// can implement ServerBackend against Redis or a similar store.
+type ServerBackend interface {
+	Load(sessionID string) ([]*Message, error)
+	Save(sessionID string, msgs []*Message) error
+	Delete(sessionID string) error
+}
+
+// ServerStore keeps flash messages in Backend, storing only an opaque
+// session id in the cookie.
+type ServerStore struct {
+	Backend ServerBackend
+
+	// CookieName overrides the default "flash_session" cookie name.
+	CookieName string
+
+	// MaxAge sets the session cookie lifetime. Defaults to one hour.
+	MaxAge time.Duration
+}
+
+// NewServerStore returns a ServerStore backed by an in-memory
+// MemoryBackend.
+func NewServerStore() *ServerStore {
+	return &ServerStore{Backend: NewMemoryBackend()}
+}
+
+func (s *ServerStore) Save(w http.ResponseWriter, r *http.Request, msgs []*Message) error {
+	ensureMeta(msgs)
+	sessionID, ok := s.sessionID(w, r)
+	if !ok {
+		var err error
+		if sessionID, err = newSessionID(); err != nil {
+			return err
+		}
+		http.SetCookie(w, &http.Cookie{
+			Name:     s.cookieName(),
+			Value:    sessionID,
+			HttpOnly: true,
+			Expires:  time.Now().Add(s.maxAge()),
+		})
+	}
+
+	existing, err := s.Backend.Load(sessionID)
+	if err != nil {
+		return err
+	}
+	return s.Backend.Save(sessionID, append(existing, msgs...))
+}
+
+func (s *ServerStore) Load(w http.ResponseWriter, r *http.Request) ([]*Message, error) {
+	sessionID, ok := s.sessionID(w, r)
+	if !ok {
+		return nil, nil
+	}
+	return s.Backend.Load(sessionID)
+}
+
+func (s *ServerStore) Clear(w http.ResponseWriter, r *http.Request) error {
+	sessionID, ok := s.sessionID(w, r)
+	if !ok {
+		return nil
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     s.cookieName(),
+		MaxAge:   -1,
+		Expires:  time.Unix(1, 0),
+		HttpOnly: true,
+	})
+	return s.Backend.Delete(sessionID)
+}
+
+func (s *ServerStore) cookieName() string {
+	if s.CookieName != "" {
+		return s.CookieName
+	}
+	return "flash_session"
+}
+
+func (s *ServerStore) maxAge() time.Duration {
+	if s.MaxAge != 0 {
+		return s.MaxAge
+	}
+	return time.Hour
+}
+
+// sessionID returns the session id cookie value, merging r and w as
+// singleCookieValue does.
+func (s *ServerStore) sessionID(w http.ResponseWriter, r *http.Request) (string, bool) {
+	return singleCookieValue(w, r, s.cookieName())
+}
+
+func newSessionID() (string, error) {
+	raw := make([]byte, 16)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(raw), nil
+}
+
+// MemoryBackend is an in-memory ServerBackend suitable for single-instance
+// deployments or tests. Entries are never evicted, so long running
+// processes that expect a lot of sessions should use a backend with
+// expiration, such as Redis.
+type MemoryBackend struct {
+	mu   sync.Mutex
+	data map[string][]*Message
+}
+
+// NewMemoryBackend returns an empty MemoryBackend.
+func NewMemoryBackend() *MemoryBackend {
+	return &MemoryBackend{data: make(map[string][]*Message)}
+}
+
+func (b *MemoryBackend) Load(sessionID string) ([]*Message, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]*Message(nil), b.data[sessionID]...), nil
+}
+
+func (b *MemoryBackend) Save(sessionID string, msgs []*Message) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.data[sessionID] = msgs
+	return nil
+}
+
+func (b *MemoryBackend) Delete(sessionID string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.data, sessionID)
+	return nil
+}
@@ -0,0 +1,193 @@
+package flash
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// SignedCookieStore keeps all flash messages in a single cookie, named
+// "flash" by default, HMAC-signed with Key to prevent tampering. If
+// Encrypt is set, the payload is additionally sealed with AES-GCM derived
+// from Key, so that clients cannot read the message contents either.
+//
+// Unlike CookieStore, which adds one cookie per message, SignedCookieStore
+// never uses more than a single cookie, regardless of how many messages
+// are pushed in between requests.
+type SignedCookieStore struct {
+	// Key signs (and, if Encrypt is set, encrypts) the flash cookie. It
+	// should be at least 32 bytes of random data.
+	Key []byte
+
+	// Encrypt, when set, seals the cookie payload with AES-GCM in
+	// addition to signing it.
+	Encrypt bool
+
+	// CookieName overrides the default "flash" cookie name.
+	CookieName string
+
+	// MaxAge sets the cookie lifetime. Defaults to one hour.
+	MaxAge time.Duration
+}
+
+// NewSignedCookieStore returns a SignedCookieStore that signs (and, if
+// encrypt is true, encrypts) the flash cookie using key.
+func NewSignedCookieStore(key []byte, encrypt bool) *SignedCookieStore {
+	return &SignedCookieStore{Key: key, Encrypt: encrypt}
+}
+
+func (s *SignedCookieStore) Save(w http.ResponseWriter, r *http.Request, msgs []*Message) error {
+	ensureMeta(msgs)
+	existing, _ := s.Load(w, r)
+
+	raw, err := json.Marshal(append(existing, msgs...))
+	if err != nil {
+		return fmt.Errorf("cannot marshal messages: %w", err)
+	}
+	sealed, err := s.seal(raw)
+	if err != nil {
+		return fmt.Errorf("cannot seal messages: %w", err)
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     s.cookieName(),
+		Value:    base64.StdEncoding.EncodeToString(sealed),
+		HttpOnly: true,
+		Expires:  time.Now().Add(s.maxAge()),
+	})
+	return nil
+}
+
+func (s *SignedCookieStore) Load(w http.ResponseWriter, r *http.Request) ([]*Message, error) {
+	raw, ok := s.cookieValue(w, r)
+	if !ok {
+		return nil, nil
+	}
+	sealed, err := base64.StdEncoding.DecodeString(raw)
+	if err != nil {
+		return nil, nil
+	}
+	payload, err := s.unseal(sealed)
+	if err != nil {
+		return nil, nil
+	}
+	var msgs []*Message
+	if err := json.Unmarshal(payload, &msgs); err != nil {
+		return nil, nil
+	}
+	return msgs, nil
+}
+
+func (s *SignedCookieStore) Clear(w http.ResponseWriter, r *http.Request) error {
+	http.SetCookie(w, &http.Cookie{
+		Name:     s.cookieName(),
+		MaxAge:   -1,
+		Expires:  time.Unix(1, 0),
+		HttpOnly: true,
+	})
+	return nil
+}
+
+func (s *SignedCookieStore) cookieName() string {
+	if s.CookieName != "" {
+		return s.CookieName
+	}
+	return "flash"
+}
+
+func (s *SignedCookieStore) maxAge() time.Duration {
+	if s.MaxAge != 0 {
+		return s.MaxAge
+	}
+	return time.Hour
+}
+
+// cookieValue returns the flash cookie value, merging r and w as
+// singleCookieValue does.
+func (s *SignedCookieStore) cookieValue(w http.ResponseWriter, r *http.Request) (string, bool) {
+	return singleCookieValue(w, r, s.cookieName())
+}
+
+func (s *SignedCookieStore) seal(raw []byte) ([]byte, error) {
+	if s.Encrypt {
+		encrypted, err := s.encrypt(raw)
+		if err != nil {
+			return nil, err
+		}
+		raw = encrypted
+	}
+	return s.sign(raw), nil
+}
+
+func (s *SignedCookieStore) unseal(sealed []byte) ([]byte, error) {
+	raw, err := s.verify(sealed)
+	if err != nil {
+		return nil, err
+	}
+	if s.Encrypt {
+		return s.decrypt(raw)
+	}
+	return raw, nil
+}
+
+func (s *SignedCookieStore) sign(raw []byte) []byte {
+	mac := hmac.New(sha256.New, s.Key)
+	mac.Write(raw)
+	return append(mac.Sum(nil), raw...)
+}
+
+func (s *SignedCookieStore) verify(sealed []byte) ([]byte, error) {
+	mac := hmac.New(sha256.New, s.Key)
+	size := mac.Size()
+	if len(sealed) < size {
+		return nil, errors.New("flash: malformed signed cookie")
+	}
+	sum, raw := sealed[:size], sealed[size:]
+	mac.Write(raw)
+	if !hmac.Equal(sum, mac.Sum(nil)) {
+		return nil, errors.New("flash: signed cookie signature mismatch")
+	}
+	return raw, nil
+}
+
+func (s *SignedCookieStore) encrypt(raw []byte) ([]byte, error) {
+	gcm, err := s.gcm()
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, raw, nil), nil
+}
+
+func (s *SignedCookieStore) decrypt(sealed []byte) ([]byte, error) {
+	gcm, err := s.gcm()
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("flash: malformed encrypted cookie")
+	}
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, ciphertext, nil)
+}
+
+func (s *SignedCookieStore) gcm() (cipher.AEAD, error) {
+	sum := sha256.Sum256(s.Key)
+	block, err := aes.NewCipher(sum[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
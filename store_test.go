@@ -0,0 +1,194 @@
+package flash
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSignedCookieStoreRoundTrip(t *testing.T) {
+	for _, encrypt := range []bool{false, true} {
+		store := NewSignedCookieStore([]byte("01234567890123456789012345678901"), encrypt)
+
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/", nil)
+
+		if err := store.Save(w, r, []*Message{{Category: "a-category", Text: "a-text"}}); err != nil {
+			t.Fatalf("cannot save message: %s", err)
+		}
+
+		msgs, err := store.Load(w, r)
+		if err != nil {
+			t.Fatalf("cannot load messages: %s", err)
+		}
+		if len(msgs) != 1 || msgs[0].Category != "a-category" || msgs[0].Text != "a-text" {
+			t.Fatalf("unexpected messages: %+v", msgs)
+		}
+
+		if err := store.Clear(w, r); err != nil {
+			t.Fatalf("cannot clear messages: %s", err)
+		}
+		if msgs, _ := store.Load(w, r); len(msgs) != 0 {
+			t.Fatalf("messages must be cleared, got %d", len(msgs))
+		}
+	}
+}
+
+func TestSignedCookieStoreRejectsTamperedCookie(t *testing.T) {
+	store := NewSignedCookieStore([]byte("01234567890123456789012345678901"), false)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+	if err := store.Save(w, r, []*Message{{Category: "a-category", Text: "a-text"}}); err != nil {
+		t.Fatalf("cannot save message: %s", err)
+	}
+
+	cookies := w.Result().Cookies()
+	r2 := httptest.NewRequest("GET", "/", nil)
+	cookies[0].Value += "tampered"
+	r2.AddCookie(cookies[0])
+
+	w2 := httptest.NewRecorder()
+	if msgs, _ := store.Load(w2, r2); len(msgs) != 0 {
+		t.Fatalf("tampered cookie must not decode, got %d messages", len(msgs))
+	}
+}
+
+func TestPushAcrossRequestsAccumulatesIntoSignedCookieStore(t *testing.T) {
+	orig := DefaultStore
+	defer func() { DefaultStore = orig }()
+	DefaultStore = NewSignedCookieStore([]byte("01234567890123456789012345678901"), false)
+
+	w1 := httptest.NewRecorder()
+	r1 := httptest.NewRequest("GET", "/", nil)
+	Push(w1, r1, "a-category", "a-text")
+
+	r2 := httptest.NewRequest("GET", "/", nil)
+	for _, c := range w1.Result().Cookies() {
+		r2.AddCookie(c)
+	}
+	w2 := httptest.NewRecorder()
+	Push(w2, r2, "a-category", "b-text")
+
+	r3 := httptest.NewRequest("GET", "/", nil)
+	for _, c := range w2.Result().Cookies() {
+		r3.AddCookie(c)
+	}
+	w3 := httptest.NewRecorder()
+	msgs := PopAll(w3, r3)
+	if len(msgs) != 2 {
+		t.Fatalf("want both messages pushed across requests, got %d", len(msgs))
+	}
+}
+
+func TestServerStoreRoundTrip(t *testing.T) {
+	store := NewServerStore()
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+
+	if err := store.Save(w, r, []*Message{{Category: "a-category", Text: "a-text"}}); err != nil {
+		t.Fatalf("cannot save message: %s", err)
+	}
+
+	msgs, err := store.Load(w, r)
+	if err != nil {
+		t.Fatalf("cannot load messages: %s", err)
+	}
+	if len(msgs) != 1 {
+		t.Fatalf("want one message, got %d", len(msgs))
+	}
+
+	if err := store.Clear(w, r); err != nil {
+		t.Fatalf("cannot clear messages: %s", err)
+	}
+	if msgs, _ := store.Load(w, r); len(msgs) != 0 {
+		t.Fatalf("messages must be cleared, got %d", len(msgs))
+	}
+}
+
+func TestEmbedWithStore(t *testing.T) {
+	store := NewServerStore()
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+	if err := store.Save(w, r, []*Message{{Category: "a-category", Text: "a-text"}}); err != nil {
+		t.Fatalf("cannot save message: %s", err)
+	}
+
+	// Copy the pending session cookie onto the next request, as a
+	// browser would.
+	r2 := httptest.NewRequest("GET", "/", nil)
+	for _, c := range w.Result().Cookies() {
+		r2.AddCookie(c)
+	}
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`<!doctype html><body></body>`))
+	})
+
+	app := Embed(nil, WithStore(store))(handler)
+	w2 := httptest.NewRecorder()
+	app.ServeHTTP(w2, r2)
+
+	if body := w2.Body.String(); body == `<!doctype html><body></body>` {
+		t.Fatalf("flash message was not embedded: %s", body)
+	}
+}
+
+func TestPushInsideEmbedUsesConfiguredStore(t *testing.T) {
+	store := NewServerStore()
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		Push(w, r, "a-category", "a-text")
+	})
+
+	app := Embed(nil, WithStore(store))(handler)
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+	app.ServeHTTP(w, r)
+
+	// Copy the response cookies onto the next request, as a browser
+	// would, and check the message landed in the configured ServerStore
+	// rather than as a flash_* cookie set by the default CookieStore.
+	r2 := httptest.NewRequest("GET", "/", nil)
+	for _, c := range w.Result().Cookies() {
+		r2.AddCookie(c)
+	}
+	msgs, err := store.Load(httptest.NewRecorder(), r2)
+	if err != nil {
+		t.Fatalf("cannot load messages: %s", err)
+	}
+	if len(msgs) != 1 || msgs[0].Text != "a-text" {
+		t.Fatalf("Push did not reach the configured ServerStore, got %+v", msgs)
+	}
+
+	if msgs, _ := DefaultStore.Load(httptest.NewRecorder(), r2); len(msgs) != 0 {
+		t.Fatalf("Push must not also fall back to the default CookieStore, got %+v", msgs)
+	}
+}
+
+func TestPushInsideEmbedHonorsWithLimits(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, text := range []string{"a", "b", "c", "d", "e"} {
+			Push(w, r, "a-category", text)
+		}
+	})
+
+	app := Embed(nil, WithLimits(Config{MaxMessages: 2}))(handler)
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+	app.ServeHTTP(w, r)
+
+	r2 := httptest.NewRequest("GET", "/", nil)
+	for _, c := range w.Result().Cookies() {
+		r2.AddCookie(c)
+	}
+	msgs, err := DefaultStore.Load(httptest.NewRecorder(), r2)
+	if err != nil {
+		t.Fatalf("cannot load messages: %s", err)
+	}
+	if len(msgs) != 2 || msgs[0].Text != "d" || msgs[1].Text != "e" {
+		t.Fatalf("WithLimits(MaxMessages: 2) must cap Push calls made inside the handler, got %+v", msgs)
+	}
+}
@@ -0,0 +1,72 @@
+package flash
+
+import (
+	"html/template"
+	"regexp"
+	"strings"
+)
+
+// TemplateFuncs is the FuncMap made available to the default template used
+// by Embed. A custom template does not get these for free (html/template
+// functions must be registered before parsing); build it with
+// template.New(...).Funcs(flash.TemplateFuncs).Parse(...) to keep access to
+// them.
+var TemplateFuncs = template.FuncMap{
+	"byCategory":  byCategory,
+	"hasCategory": hasCategory,
+	"jsEscape":    jsEscape,
+	"markdown":    markdown,
+}
+
+// byCategory filters msgs down to those of the given category.
+func byCategory(msgs []*Message, category string) []*Message {
+	var out []*Message
+	for _, m := range msgs {
+		if m.Category == category {
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+// hasCategory reports whether any of msgs is of the given category.
+func hasCategory(msgs []*Message, category string) bool {
+	for _, m := range msgs {
+		if m.Category == category {
+			return true
+		}
+	}
+	return false
+}
+
+// jsEscape escapes s so that it can be safely embedded, without
+// surrounding quotes of your own, as a quoted JavaScript string literal,
+// for example when building a toast notification from flash messages in
+// an inline <script> block:
+//
+//	<script>var msg = {{jsEscape .Text}};</script>
+//
+// It returns template.JSStr, not a plain string, so that html/template's
+// contextual autoescaper adds the surrounding quotes itself and treats the
+// escaped content as already safe for that position, rather than escaping
+// it a second time. Writing your own quotes around {{jsEscape .Text}}
+// defeats this and results in double-escaped output.
+func jsEscape(s string) template.JSStr {
+	return template.JSStr(template.JSEscapeString(s))
+}
+
+var (
+	markdownBold   = regexp.MustCompile(`\*\*(.+?)\*\*`)
+	markdownItalic = regexp.MustCompile(`\*(.+?)\*`)
+)
+
+// markdown renders a minimal subset of Markdown (**bold**, *italic* and
+// line breaks) as HTML. It is meant for short, trusted flash message text,
+// not as a general purpose Markdown renderer.
+func markdown(s string) template.HTML {
+	escaped := template.HTMLEscapeString(s)
+	escaped = markdownBold.ReplaceAllString(escaped, "<strong>$1</strong>")
+	escaped = markdownItalic.ReplaceAllString(escaped, "<em>$1</em>")
+	escaped = strings.ReplaceAll(escaped, "\n", "<br>")
+	return template.HTML(escaped)
+}
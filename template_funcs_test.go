@@ -0,0 +1,54 @@
+package flash
+
+import (
+	"bytes"
+	"html/template"
+	"testing"
+)
+
+func TestByCategoryAndHasCategory(t *testing.T) {
+	msgs := []*Message{
+		{Category: "info", Text: "a"},
+		{Category: "error", Text: "b"},
+		{Category: "info", Text: "c"},
+	}
+
+	info := byCategory(msgs, "info")
+	if len(info) != 2 || info[0].Text != "a" || info[1].Text != "c" {
+		t.Fatalf("unexpected filtered messages: %+v", info)
+	}
+
+	if !hasCategory(msgs, "error") {
+		t.Fatalf("want hasCategory to find the error message")
+	}
+	if hasCategory(msgs, "warning") {
+		t.Fatalf("want hasCategory to not find a missing category")
+	}
+}
+
+func TestMarkdown(t *testing.T) {
+	got := markdown("**bold** and *italic* <script>")
+	want := `<strong>bold</strong> and <em>italic</em> &lt;script&gt;`
+	if string(got) != want {
+		t.Fatalf("want %s\ngot: %s", want, got)
+	}
+}
+
+func TestJSEscapeInScriptContext(t *testing.T) {
+	// jsEscape supplies its own quotes (see its doc comment); wrapping
+	// {{jsEscape .}} in another pair would make html/template treat the
+	// pre-escaped content as raw and escape it a second time.
+	tmpl := template.Must(template.New("").Funcs(TemplateFuncs).Parse(
+		`<script>var msg = {{jsEscape .}};</script>`,
+	))
+
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, "say \"hi\"\n\\backslash"); err != nil {
+		t.Fatalf("cannot execute template: %s", err)
+	}
+
+	const want = `<script>var msg = "say \"hi\"` + "\\u000A" + `\\backslash";</script>`
+	if got := b.String(); got != want {
+		t.Fatalf("want %s\ngot: %s", want, got)
+	}
+}